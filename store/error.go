@@ -0,0 +1,62 @@
+package store
+
+import "fmt"
+
+// error codes returned by the store; these are stable across releases so
+// the HTTP layer can map them to the right status code / client message
+const (
+	EcodeKeyNotFound = 100
+	EcodeTestFailed  = 101
+	EcodeNotFile     = 102
+	EcodeNotDir      = 104
+	EcodeNodeExist   = 105
+	EcodeDirNotEmpty = 108
+
+	EcodeEventIndexCleared = 401
+)
+
+var errorMessages = map[int]string{
+	EcodeKeyNotFound: "Key Not Found",
+	EcodeTestFailed:  "Test Failed",
+	EcodeNotFile:     "Not A File",
+	EcodeNotDir:      "Not A Directory",
+	EcodeNodeExist:   "Already exists",
+	EcodeDirNotEmpty: "Directory not empty",
+
+	EcodeEventIndexCleared: "The event in requested index is outdated and cleared",
+}
+
+// StoreError is returned whenever a store operation cannot be completed;
+// ErrorCode lets callers (e.g. the HTTP layer) distinguish failure kinds
+// without parsing Message. Index and Value are only populated for
+// EcodeTestFailed, where they report the node's actual state so the
+// caller can explain why the compare failed.
+type StoreError struct {
+	ErrorCode int
+	Message   string
+	Cause     string
+	Index     uint64
+	Value     string
+}
+
+// NewError builds a StoreError for errorCode, recording cause (usually
+// the key involved) for debugging.
+func NewError(errorCode int, cause string) *StoreError {
+	return &StoreError{ErrorCode: errorCode, Message: errorMessages[errorCode], Cause: cause}
+}
+
+// newTestFailedError builds the EcodeTestFailed error raised by a failed
+// TestAndSet/TestAndDelete, carrying the node's actual value and index.
+func newTestFailedError(key string, node Node) *StoreError {
+	return &StoreError{
+		ErrorCode: EcodeTestFailed,
+		Message:   errorMessages[EcodeTestFailed],
+		Cause:     key,
+		Index:     node.ModifiedIndex,
+		Value:     node.Value,
+	}
+}
+
+func (e StoreError) Error() string {
+	return fmt.Sprintf("%s (%s)", e.Message, e.Cause)
+}
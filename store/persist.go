@@ -0,0 +1,159 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Persister durably records what a Store needs to recover after a
+// crash: every mutation as it happens (the write-ahead log) plus
+// periodic full snapshots, so the WAL never has to be replayed from
+// the very beginning.
+type Persister interface {
+	// WriteEvent appends resp, produced by the mutation at index, to the WAL.
+	WriteEvent(index uint64, resp Response) error
+
+	// WriteSnapshot durably records state as the snapshot as of index.
+	WriteSnapshot(state []byte, index uint64) error
+
+	// LoadSnapshot returns the most recent snapshot and the index it was
+	// taken at. It returns a nil state and index 0 if none was ever written.
+	LoadSnapshot() (state []byte, index uint64, err error)
+
+	// LoadEventsSince returns, oldest first, every WAL entry with an
+	// index greater than sinceIndex.
+	LoadEventsSince(sinceIndex uint64) ([]Response, error)
+
+	// Compact discards WAL entries with index <= uptoIndex; callers
+	// should only do this once a snapshot covering them is durable.
+	Compact(uptoIndex uint64) error
+
+	Close() error
+}
+
+const (
+	walKeyPrefix     = "w/"
+	snapshotStateKey = "s/state"
+	snapshotIndexKey = "s/index"
+)
+
+// LevelDBPersister is the default Persister, backed by a LevelDB
+// database on disk.
+type LevelDBPersister struct {
+	db *leveldb.DB
+
+	// fsync every write when true; otherwise LevelDB may still be
+	// holding it in its OS write cache when the call returns
+	sync bool
+}
+
+// NewLevelDBPersister opens (creating if necessary) a LevelDB database
+// at dir. sync controls whether every WAL/snapshot write is fsynced
+// before returning, trading durability for write latency.
+func NewLevelDBPersister(dir string, sync bool) (*LevelDBPersister, error) {
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LevelDBPersister{db: db, sync: sync}, nil
+}
+
+func (p *LevelDBPersister) writeOptions() *opt.WriteOptions {
+	return &opt.WriteOptions{Sync: p.sync}
+}
+
+func walKey(index uint64) []byte {
+	key := make([]byte, len(walKeyPrefix)+8)
+	copy(key, walKeyPrefix)
+	binary.BigEndian.PutUint64(key[len(walKeyPrefix):], index)
+	return key
+}
+
+func (p *LevelDBPersister) WriteEvent(index uint64, resp Response) error {
+	value, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	return p.db.Put(walKey(index), value, p.writeOptions())
+}
+
+func (p *LevelDBPersister) WriteSnapshot(state []byte, index uint64) error {
+	idx := make([]byte, 8)
+	binary.BigEndian.PutUint64(idx, index)
+
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(snapshotStateKey), state)
+	batch.Put([]byte(snapshotIndexKey), idx)
+
+	return p.db.Write(batch, p.writeOptions())
+}
+
+func (p *LevelDBPersister) LoadSnapshot() ([]byte, uint64, error) {
+	state, err := p.db.Get([]byte(snapshotStateKey), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	idx, err := p.db.Get([]byte(snapshotIndexKey), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return state, binary.BigEndian.Uint64(idx), nil
+}
+
+func (p *LevelDBPersister) LoadEventsSince(sinceIndex uint64) ([]Response, error) {
+	iter := p.db.NewIterator(util.BytesPrefix([]byte(walKeyPrefix)), nil)
+	defer iter.Release()
+
+	var resps []Response
+
+	for iter.Next() {
+		index := binary.BigEndian.Uint64(iter.Key()[len(walKeyPrefix):])
+		if index <= sinceIndex {
+			continue
+		}
+
+		var resp Response
+		if err := json.Unmarshal(iter.Value(), &resp); err != nil {
+			return nil, err
+		}
+
+		resps = append(resps, resp)
+	}
+
+	return resps, iter.Error()
+}
+
+func (p *LevelDBPersister) Compact(uptoIndex uint64) error {
+	iter := p.db.NewIterator(util.BytesPrefix([]byte(walKeyPrefix)), nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+
+	for iter.Next() {
+		index := binary.BigEndian.Uint64(iter.Key()[len(walKeyPrefix):])
+		if index <= uptoIndex {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return p.db.Write(batch, p.writeOptions())
+}
+
+func (p *LevelDBPersister) Close() error {
+	return p.db.Close()
+}
@@ -4,7 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"path"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/google/btree"
 )
 
 // global store
@@ -16,22 +20,47 @@ const (
 	SET
 	DELETE
 	GET
+	TESTANDSET
 )
 
 var PERMANENT = time.Unix(0, 0)
 
 type Store struct {
-	// use the build-in hash map as the key-value store structure
-	Nodes map[string]Node `json:"nodes"`
+	// the keyspace, ordered by key; directories are stored as ordinary
+	// entries with Dir set to true, keyed by their full path, so ranging
+	// over a prefix doubles as a directory listing. Kept as an
+	// implementation detail: Set/Get/Delete's signatures don't change.
+	tree *btree.BTree
 
 	// the string channel to send messages to the outside world
 	// now we use it to send changes to the hub of the web service
 	messager *chan string
+
+	// fans every mutation out to watchers and keeps bounded replay history
+	watcher *WatcherHub
+
+	// serializes every read and write of the keyspace/CurrentIndex
+	worldLock sync.RWMutex
+
+	// the index of the last mutating operation; a caller passing index
+	// 0 gets the next value auto-assigned and reported back in Response.Index
+	CurrentIndex uint64 `json:"currentIndex"`
+
+	// durably records mutations (WAL) and periodic snapshots; nil means
+	// the store is memory-only, as it always was before persistence existed
+	persister Persister
 }
 
 type Node struct {
 	Value string `json:"value"`
 
+	// true if this entry is a directory; directories never carry a Value
+	Dir bool `json:"dir,omitempty"`
+
+	// the index of the operation that last set this node's Value;
+	// compared against TestAndSet/TestAndDelete's prevIndex
+	ModifiedIndex uint64 `json:"modifiedIndex"`
+
 	// if the node is a permanent one the ExprieTime will be Unix(0,0)
 	// Otherwise after the expireTime, the node will be deleted
 	ExpireTime time.Time `json:"expireTime"`
@@ -53,6 +82,13 @@ type Response struct {
 	Expiration time.Time `json:"expiration"`
 
 	Index uint64 `json:"index"`
+
+	// true if Key refers to a directory
+	Dir bool `json:"dir,omitempty"`
+
+	// populated by List: the entries found directly (or, if recursive,
+	// anywhere) under Key
+	KVs []*Response `json:"kvs,omitempty"`
 }
 
 func init() {
@@ -63,7 +99,8 @@ func init() {
 // make a new stroe
 func createStore() *Store {
 	s := new(Store)
-	s.Nodes = make(map[string]Node)
+	s.tree = newTree()
+	s.watcher = newWatcherHub(defaultHistoryCapacity)
 	return s
 }
 
@@ -77,8 +114,230 @@ func (s *Store) SetMessager(messager *chan string) {
 	s.messager = messager
 }
 
+// SetPersister attaches p as the store's write-ahead log and snapshot
+// destination. Every subsequent mutation is appended to it; it is not
+// consulted for past state (use RecoverFromPersister for that).
+func (s *Store) SetPersister(p Persister) {
+	s.worldLock.Lock()
+	defer s.worldLock.Unlock()
+
+	s.persister = p
+}
+
+// persist appends resp, produced by the mutation at index, to the WAL if
+// a Persister is configured. Callers must hold worldLock.
+func (s *Store) persist(index uint64, resp Response) {
+	if s.persister == nil {
+		return
+	}
+
+	if err := s.persister.WriteEvent(index, resp); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// SnapshotNow writes a full snapshot of the current state to the
+// configured Persister, tagged with the index it reflects. It is a
+// no-op if no Persister is configured.
+func (s *Store) SnapshotNow() error {
+	s.worldLock.RLock()
+	defer s.worldLock.RUnlock()
+
+	if s.persister == nil {
+		return nil
+	}
+
+	state, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return s.persister.WriteSnapshot(state, s.CurrentIndex)
+}
+
+// StartSnapshotting calls SnapshotNow every interval until the returned
+// stop func is invoked.
+func (s *Store) StartSnapshotting(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.SnapshotNow(); err != nil {
+					fmt.Println(err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// Compact discards WAL entries with index <= uptoIndex. It does not check
+// that a durable snapshot covers them. It is a no-op if no Persister is
+// configured.
+func (s *Store) Compact(uptoIndex uint64) error {
+	s.worldLock.Lock()
+	defer s.worldLock.Unlock()
+
+	if s.persister == nil {
+		return nil
+	}
+
+	return s.persister.Compact(uptoIndex)
+}
+
+// RecoverFromPersister rebuilds the store from p: it loads the newest
+// snapshot, if any, then replays every WAL entry after the snapshot's
+// index through the normal Set/Delete/Mkdir/DeleteDir paths (so any
+// node that hasn't expired yet gets its TTL goroutine relaunched). The
+// messager is suppressed during replay so it isn't re-notified of
+// history. p becomes the store's Persister once replay completes.
+func (s *Store) RecoverFromPersister(p Persister) error {
+	state, snapIndex, err := p.LoadSnapshot()
+	if err != nil {
+		return err
+	}
+
+	if state != nil {
+		if err := s.Recovery(state); err != nil {
+			return err
+		}
+	}
+
+	events, err := p.LoadEventsSince(snapIndex)
+	if err != nil {
+		return err
+	}
+
+	messager := s.messager
+	s.messager = nil
+	defer func() { s.messager = messager }()
+
+	for _, resp := range events {
+		if err := replayEvent(resp); err != nil {
+			return err
+		}
+	}
+
+	s.worldLock.Lock()
+	s.persister = p
+	s.worldLock.Unlock()
+
+	return nil
+}
+
+// replayEvent re-applies a single WAL entry through the store's normal
+// mutating paths.
+func replayEvent(resp Response) error {
+	var err error
+
+	switch {
+	case resp.Action == DELETE && resp.Dir:
+		_, err = DeleteDir(resp.Key, true, resp.Index)
+	case resp.Action == DELETE:
+		_, err = Delete(resp.Key, resp.Index)
+	case resp.Dir:
+		_, err = Mkdir(resp.Key, resp.Expiration, resp.Index)
+	default:
+		_, err = Set(resp.Key, resp.NewValue, resp.Expiration, resp.Index)
+	}
+
+	return err
+}
+
+// notify records resp in the watcher hub's history and fans it out to
+// any watcher whose prefix matches
+func notify(resp Response) {
+	s.watcher.notify(resp)
+}
+
+// Watch subscribes to every change under prefix (including changes to
+// descendants when recursive is true). If sinceIndex is non-zero and
+// still within the retained history, matching past events are delivered
+// on the returned channel before it starts receiving live ones, up to
+// the channel's 100-slot buffer; older matching events beyond that are
+// dropped. If sinceIndex is older than the oldest retained event, Watch
+// returns a StoreError with EcodeEventIndexCleared. Call the returned
+// CancelFunc to stop watching.
+func Watch(prefix string, recursive bool, sinceIndex uint64) (<-chan Response, CancelFunc, error) {
+	return s.watcher.Watch(path.Clean(prefix), recursive, sinceIndex)
+}
+
+// ancestors returns the cleaned paths of every directory that must exist
+// for key to be set, in root-to-leaf order. The root itself ("/") is not
+// included.
+func ancestors(key string) []string {
+	trimmed := strings.Trim(key, "/")
+	if trimmed == "" {
+		return nil
+	}
+
+	parts := strings.Split(trimmed, "/")
+
+	dirs := make([]string, 0, len(parts)-1)
+	cur := ""
+	for i := 0; i < len(parts)-1; i++ {
+		cur = cur + "/" + parts[i]
+		dirs = append(dirs, cur)
+	}
+
+	return dirs
+}
+
+// nextIndex assigns the index a mutation should use: the caller's index
+// if it gave one (advancing CurrentIndex to match), otherwise the next
+// value after CurrentIndex. Callers must hold worldLock.
+func (s *Store) nextIndex(index uint64) uint64 {
+	if index == 0 {
+		s.CurrentIndex++
+		return s.CurrentIndex
+	}
+
+	if index > s.CurrentIndex {
+		s.CurrentIndex = index
+	}
+
+	return index
+}
+
+// createParentDirs walks the ancestors of key, auto-creating any
+// directory that does not exist yet. It fails if an ancestor already
+// exists as a non-directory node. Callers must hold worldLock.
+func (s *Store) createParentDirs(key string) error {
+	for _, dir := range ancestors(key) {
+		node, ok := s.getNode(dir)
+
+		if !ok {
+			s.putNode(dir, Node{Dir: true, ExpireTime: PERMANENT})
+			continue
+		}
+
+		if !node.Dir {
+			return NewError(EcodeNotDir, dir)
+		}
+	}
+
+	return nil
+}
+
 // set the key to value, return the old value if the key exists
 func Set(key string, value string, expireTime time.Time, index uint64) ([]byte, error) {
+	s.worldLock.Lock()
+	defer s.worldLock.Unlock()
+
+	return s.set(SET, key, value, expireTime, index)
+}
+
+// set performs a Set under the given action, so that a successful
+// TestAndSet can report itself as TESTANDSET rather than SET. Callers
+// must hold worldLock.
+func (s *Store) set(action int, key string, value string, expireTime time.Time, index uint64) ([]byte, error) {
 
 	key = path.Clean(key)
 
@@ -90,18 +349,37 @@ func Set(key string, value string, expireTime time.Time, index uint64) ([]byte,
 	// the key may be expired, we should not add the node
 	// also if the node exist, we need to delete the node
 	if isExpire && expireTime.Sub(time.Now()) < 0 {
-		return Delete(key, index)
+		return s.delete(key, index)
+	}
+
+	if err := s.createParentDirs(key); err != nil {
+		return nil, err
 	}
 
 	// get the node
-	node, ok := s.Nodes[key]
+	node, ok := s.getNode(key)
+
+	if ok && node.Dir {
+		return nil, NewError(EcodeNotFile, key)
+	}
+
+	index = s.nextIndex(index)
 
 	if ok {
 		// if node is not permanent before
 		// update its expireTime
 		if !node.ExpireTime.Equal(PERMANENT) {
 
-			node.update <- expireTime
+			select {
+			case node.update <- expireTime:
+			default:
+				// the old expire goroutine already fired and is gone; start a
+				// new one unless the node is becoming permanent
+				node.update = make(chan time.Time)
+				if isExpire {
+					go expire(key, node.update, expireTime)
+				}
+			}
 
 		} else {
 			// if we want the permanent node to have expire time
@@ -113,13 +391,14 @@ func Set(key string, value string, expireTime time.Time, index uint64) ([]byte,
 		}
 
 		// update the information of the node
-		s.Nodes[key] = Node{value, expireTime, node.update}
+		s.putNode(key, Node{Value: value, ModifiedIndex: index, ExpireTime: expireTime, update: node.update})
 
-		resp := Response{SET, key, node.Value, value, true, expireTime, index}
+		resp := Response{action, key, node.Value, value, true, expireTime, index, false, nil}
 
 		msg, err := json.Marshal(resp)
 
 		notify(resp)
+		s.persist(index, resp)
 
 		// send to the messager
 		if s.messager != nil && err == nil {
@@ -134,18 +413,19 @@ func Set(key string, value string, expireTime time.Time, index uint64) ([]byte,
 
 		update := make(chan time.Time)
 
-		s.Nodes[key] = Node{value, expireTime, update}
+		s.putNode(key, Node{Value: value, ModifiedIndex: index, ExpireTime: expireTime, update: update})
 
 		if isExpire {
 			go expire(key, update, expireTime)
 		}
 
-		resp := Response{SET, key, "", value, false, expireTime, index}
+		resp := Response{action, key, "", value, false, expireTime, index, false, nil}
 
 		msg, err := json.Marshal(resp)
 
 		// nofity the watcher
 		notify(resp)
+		s.persist(index, resp)
 
 		// notify the web interface
 		if s.messager != nil && err == nil {
@@ -157,7 +437,121 @@ func Set(key string, value string, expireTime time.Time, index uint64) ([]byte,
 	}
 }
 
-// should be used as a go routine to delete the key when it expires
+// compareNode reports whether node satisfies a conditional operation's
+// expectations: an empty prevValue or a zero prevIndex means "don't care"
+// about that half of the comparison.
+func compareNode(node Node, prevValue string, prevIndex uint64) bool {
+	if prevValue != "" && prevValue != node.Value {
+		return false
+	}
+
+	if prevIndex != 0 && prevIndex != node.ModifiedIndex {
+		return false
+	}
+
+	return true
+}
+
+// TestAndSet atomically compares key's current value and/or modified
+// index against prevValue/prevIndex and, only if both match, sets it to
+// value. On a failed compare it returns an EcodeTestFailed StoreError
+// carrying the node's actual value and index.
+func TestAndSet(key, prevValue string, prevIndex uint64, value string, expireTime time.Time, index uint64) ([]byte, error) {
+	key = path.Clean(key)
+
+	s.worldLock.Lock()
+	defer s.worldLock.Unlock()
+
+	node, ok := s.getNode(key)
+
+	if !ok {
+		return nil, NewError(EcodeKeyNotFound, key)
+	}
+
+	if node.Dir {
+		return nil, NewError(EcodeNotFile, key)
+	}
+
+	if !compareNode(node, prevValue, prevIndex) {
+		return nil, newTestFailedError(key, node)
+	}
+
+	return s.set(TESTANDSET, key, value, expireTime, index)
+}
+
+// TestAndDelete atomically compares key's current value and/or modified
+// index against prevValue/prevIndex and, only if both match, deletes it.
+// On a failed compare it returns an EcodeTestFailed StoreError carrying
+// the node's actual value and index.
+func TestAndDelete(key string, prevValue string, prevIndex uint64, index uint64) ([]byte, error) {
+	key = path.Clean(key)
+
+	s.worldLock.Lock()
+	defer s.worldLock.Unlock()
+
+	node, ok := s.getNode(key)
+
+	if !ok {
+		return nil, NewError(EcodeKeyNotFound, key)
+	}
+
+	if node.Dir {
+		return nil, NewError(EcodeNotFile, key)
+	}
+
+	if !compareNode(node, prevValue, prevIndex) {
+		return nil, newTestFailedError(key, node)
+	}
+
+	return s.delete(key, index)
+}
+
+// Mkdir creates an empty directory at key, auto-creating any missing
+// parent directories along the way. It fails if key already exists,
+// whether as a file or a directory.
+func Mkdir(key string, expireTime time.Time, index uint64) ([]byte, error) {
+	key = path.Clean(key)
+
+	s.worldLock.Lock()
+	defer s.worldLock.Unlock()
+
+	if err := s.createParentDirs(key); err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.getNode(key); ok {
+		return nil, NewError(EcodeNodeExist, key)
+	}
+
+	index = s.nextIndex(index)
+
+	update := make(chan time.Time)
+
+	s.putNode(key, Node{Dir: true, ModifiedIndex: index, ExpireTime: expireTime, update: update})
+
+	if !expireTime.Equal(PERMANENT) {
+		go expire(key, update, expireTime)
+	}
+
+	resp := Response{SET, key, "", "", false, expireTime, index, true, nil}
+
+	msg, err := json.Marshal(resp)
+
+	notify(resp)
+	s.persist(index, resp)
+
+	if s.messager != nil && err == nil {
+		*s.messager <- string(msg)
+	}
+
+	return msg, err
+}
+
+// should be used as a go routine to delete the key when it expires. The
+// select on update never blocks the writer: once this goroutine commits
+// to the timeout branch it stops listening on update, so Set/Delete must
+// send to it non-blockingly (see the select/default sites in set, delete
+// and DeleteDir).
 func expire(key string, update chan time.Time, expireTime time.Time) {
 	duration := expireTime.Sub(time.Now())
 
@@ -165,29 +559,39 @@ func expire(key string, update chan time.Time, expireTime time.Time) {
 		select {
 		// timeout delete the node
 		case <-time.After(duration):
-			node, ok := s.Nodes[key]
-			if !ok {
+			s.worldLock.Lock()
+
+			node, ok := s.getNode(key)
+			// the cancelling Set/Delete may have already replaced this node
+			// (by key) before this goroutine got scheduled, racing ahead of
+			// its own non-blocking send on update; node.update identifies
+			// which generation of the key this goroutine owns, so only
+			// delete if it's still the one we're watching
+			if !ok || node.update != update {
+				s.worldLock.Unlock()
 				return
-			} else {
-
-				delete(s.Nodes, key)
+			}
 
-				resp := Response{DELETE, key, node.Value, "", true, node.ExpireTime, 0}
+			s.deleteNode(key)
+			index := s.nextIndex(0)
 
-				msg, err := json.Marshal(resp)
+			resp := Response{DELETE, key, node.Value, "", true, node.ExpireTime, index, node.Dir, nil}
 
-				notify(resp)
+			notify(resp)
+			s.persist(index, resp)
 
-				// notify the messager
-				if s.messager != nil && err == nil {
+			s.worldLock.Unlock()
 
-					*s.messager <- string(msg)
-				}
+			msg, err := json.Marshal(resp)
 
-				return
+			// notify the messager
+			if s.messager != nil && err == nil {
 
+				*s.messager <- string(msg)
 			}
 
+			return
+
 		case updateTime := <-update:
 			//update duration
 			// if the node become a permanent one, the go routine is
@@ -202,44 +606,124 @@ func expire(key string, update chan time.Time, expireTime time.Time) {
 	}
 }
 
-// get the value of the key
+// get the value of the key; if key is a directory, Get behaves like
+// List(key, false). There is no separate sort option: the keyspace is
+// backed by a B-Tree (see tree.go), so a directory's entries always come
+// back in ascending key order as a natural consequence of iterating it.
 func Get(key string) Response {
+	s.worldLock.RLock()
+	defer s.worldLock.RUnlock()
+
 	key = path.Clean(key)
 
-	node, ok := s.Nodes[key]
+	node, ok := s.getNode(key)
 
 	if ok {
-		return Response{GET, key, node.Value, node.Value, true, node.ExpireTime, 0}
+		if node.Dir {
+			return s.list(key, false)
+		}
+		return Response{GET, key, node.Value, node.Value, true, node.ExpireTime, 0, false, nil}
 	} else {
-		return Response{GET, key, "", "", false, time.Unix(0, 0), 0}
+		return Response{GET, key, "", "", false, time.Unix(0, 0), 0, false, nil}
+	}
+}
+
+// List returns the entries found directly under the directory at key, or,
+// when recursive is true, every entry anywhere underneath it, always in
+// ascending key order (the B-Tree backing the keyspace makes this the
+// natural iteration order, so there is no separate sort option). If key
+// is not a directory, List falls back to a plain Get.
+func List(key string, recursive bool) Response {
+	s.worldLock.RLock()
+	defer s.worldLock.RUnlock()
+
+	return s.list(path.Clean(key), recursive)
+}
+
+// list is the unlocked core of List/Get. Callers must hold worldLock
+// (for reading).
+func (s *Store) list(key string, recursive bool) Response {
+	node, ok := s.getNode(key)
+
+	if !ok {
+		return Response{GET, key, "", "", false, time.Unix(0, 0), 0, false, nil}
+	}
+
+	if !node.Dir {
+		return Response{GET, key, node.Value, node.Value, true, node.ExpireTime, 0, false, nil}
+	}
+
+	resp := Response{GET, key, "", "", true, node.ExpireTime, 0, true, s.listChildren(key, recursive)}
+
+	return resp
+}
+
+// listChildren collects the Responses for every entry directly inside
+// dir, descending into sub-directories when recursive is true. Callers
+// must hold worldLock (for reading).
+func (s *Store) listChildren(dir string, recursive bool) []*Response {
+	prefix := dir
+	if prefix != "/" {
+		prefix += "/"
 	}
+
+	children := make([]*Response, 0)
+
+	s.ascendPrefix(prefix, func(k string, node Node) bool {
+		rest := strings.TrimPrefix(k, prefix)
+		if recursive || !strings.Contains(rest, "/") {
+			resp := nodeResponse(k, node)
+			children = append(children, &resp)
+		}
+
+		return true
+	})
+
+	return children
 }
 
 // delete the key
 func Delete(key string, index uint64) ([]byte, error) {
-	key = path.Clean(key)
+	s.worldLock.Lock()
+	defer s.worldLock.Unlock()
+
+	return s.delete(path.Clean(key), index)
+}
 
-	node, ok := s.Nodes[key]
+// delete is the unlocked core of Delete. Callers must hold worldLock.
+func (s *Store) delete(key string, index uint64) ([]byte, error) {
+	node, ok := s.getNode(key)
 
 	if ok {
 
+		if node.Dir {
+			return nil, NewError(EcodeNotFile, key)
+		}
+
+		index = s.nextIndex(index)
+
 		if node.ExpireTime.Equal(PERMANENT) {
 
-			delete(s.Nodes, key)
+			s.deleteNode(key)
 
 		} else {
 
-			// kill the expire go routine
-			node.update <- PERMANENT
-			delete(s.Nodes, key)
+			// kill the expire go routine; it may already have fired and
+			// stopped listening, so the send must not block
+			select {
+			case node.update <- PERMANENT:
+			default:
+			}
+			s.deleteNode(key)
 
 		}
 
-		resp := Response{DELETE, key, node.Value, "", true, node.ExpireTime, index}
+		resp := Response{DELETE, key, node.Value, "", true, node.ExpireTime, index, false, nil}
 
 		msg, err := json.Marshal(resp)
 
 		notify(resp)
+		s.persist(index, resp)
 
 		// notify the messager
 		if s.messager != nil && err == nil {
@@ -251,12 +735,93 @@ func Delete(key string, index uint64) ([]byte, error) {
 
 	} else {
 
-		return json.Marshal(Response{DELETE, key, "", "", false, time.Unix(0, 0), index})
+		return json.Marshal(Response{DELETE, key, "", "", false, time.Unix(0, 0), index, false, nil})
+	}
+}
+
+// DeleteDir removes the directory at key. If recursive is false the
+// directory must be empty; if recursive is true, all of its descendants
+// are cascade-deleted as well.
+func DeleteDir(key string, recursive bool, index uint64) ([]byte, error) {
+	key = path.Clean(key)
+
+	s.worldLock.Lock()
+	defer s.worldLock.Unlock()
+
+	node, ok := s.getNode(key)
+
+	if !ok {
+		return json.Marshal(Response{DELETE, key, "", "", false, time.Unix(0, 0), index, true, nil})
+	}
+
+	if !node.Dir {
+		return nil, NewError(EcodeNotDir, key)
+	}
+
+	prefix := key
+	if prefix != "/" {
+		prefix += "/"
+	}
+
+	hasChildren := false
+	s.ascendPrefix(prefix, func(k string, node Node) bool {
+		hasChildren = true
+		return false
+	})
+
+	if hasChildren && !recursive {
+		return nil, NewError(EcodeDirNotEmpty, key)
+	}
+
+	index = s.nextIndex(index)
+
+	if hasChildren {
+		type child struct {
+			key  string
+			node Node
+		}
+
+		var toDelete []child
+
+		s.ascendPrefix(prefix, func(k string, node Node) bool {
+			toDelete = append(toDelete, child{k, node})
+			return true
+		})
+
+		for _, c := range toDelete {
+			// cancel any live expire goroutine, same as delete() does for
+			// a single key; otherwise it leaks until its stale timer fires
+			if !c.node.Dir && !c.node.ExpireTime.Equal(PERMANENT) {
+				select {
+				case c.node.update <- PERMANENT:
+				default:
+				}
+			}
+			s.deleteNode(c.key)
+		}
+	}
+
+	s.deleteNode(key)
+
+	resp := Response{DELETE, key, "", "", true, node.ExpireTime, index, true, nil}
+
+	msg, err := json.Marshal(resp)
+
+	notify(resp)
+	s.persist(index, resp)
+
+	if s.messager != nil && err == nil {
+		*s.messager <- string(msg)
 	}
+
+	return msg, err
 }
 
 // save the current state of the storage system
 func (s *Store) Save() ([]byte, error) {
+	s.worldLock.RLock()
+	defer s.worldLock.RUnlock()
+
 	b, err := json.Marshal(s)
 	if err != nil {
 		fmt.Println(err)
@@ -265,33 +830,46 @@ func (s *Store) Save() ([]byte, error) {
 	return b, nil
 }
 
-// recovery the state of the stroage system from a previous state
+// recovery the state of the stroage system from a previous state,
+// restoring CurrentIndex and relaunching TTL goroutines for any node
+// with at least a second left before it expires (see clean)
 func (s *Store) Recovery(state []byte) error {
+	s.worldLock.Lock()
+	defer s.worldLock.Unlock()
+
 	err := json.Unmarshal(state, s)
 
 	// clean the expired nodes
-	clean()
+	s.clean()
 
 	return err
 }
 
-// clean all expired keys
-func clean() {
-	for key, node := range s.Nodes {
-
-		if node.ExpireTime.Equal(PERMANENT) {
-			continue
-		} else {
+// clean relaunches TTL goroutines for recovered nodes (files and
+// directories) with at least a second left on their expiration, and
+// deletes the ones with less than that. Callers must hold worldLock.
+func (s *Store) clean() {
+	type entry struct {
+		key  string
+		node Node
+	}
 
-			if node.ExpireTime.Sub(time.Now()) >= time.Second {
-				node.update = make(chan time.Time)
-				go expire(key, node.update, node.ExpireTime)
+	var entries []entry
 
-			} else {
-				// we should delete this node
-				delete(s.Nodes, key)
-			}
+	s.ascendPrefix("", func(key string, node Node) bool {
+		if !node.ExpireTime.Equal(PERMANENT) {
+			entries = append(entries, entry{key, node})
+		}
+		return true
+	})
+
+	for _, e := range entries {
+		if e.node.ExpireTime.Sub(time.Now()) >= time.Second {
+			e.node.update = make(chan time.Time)
+			s.putNode(e.key, e.node)
+			go expire(e.key, e.node.update, e.node.ExpireTime)
+		} else {
+			s.deleteNode(e.key)
 		}
-
 	}
 }
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestTestAndSet verifies the compare-and-swap succeeds only when both
+// prevValue and prevIndex (when given) match the current node.
+func TestTestAndSet(t *testing.T) {
+	resetStore()
+
+	msg, err := Set("/k", "1", PERMANENT, 0)
+	if err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	var setResp Response
+	if err := json.Unmarshal(msg, &setResp); err != nil {
+		t.Fatalf("unmarshal Set response: %v", err)
+	}
+
+	if _, err := TestAndSet("/k", "wrong", 0, "2", PERMANENT, 0); err == nil {
+		t.Fatalf("TestAndSet with wrong prevValue succeeded, want EcodeTestFailed")
+	} else if se, ok := err.(*StoreError); !ok || se.ErrorCode != EcodeTestFailed {
+		t.Fatalf("TestAndSet err = %v, want EcodeTestFailed", err)
+	}
+
+	if _, err := TestAndSet("/k", "1", setResp.Index+1, "2", PERMANENT, 0); err == nil {
+		t.Fatalf("TestAndSet with wrong prevIndex succeeded, want EcodeTestFailed")
+	}
+
+	if _, err := TestAndSet("/k", "1", setResp.Index, "2", PERMANENT, 0); err != nil {
+		t.Fatalf("TestAndSet with matching prevValue/prevIndex: %v", err)
+	}
+
+	if got := Get("/k"); got.NewValue != "2" {
+		t.Fatalf("Get(/k) = %q, want %q", got.NewValue, "2")
+	}
+}
+
+// TestTestAndDelete verifies the compare-and-delete only removes the key
+// when the compare matches, and that deleting a directory is rejected.
+func TestTestAndDelete(t *testing.T) {
+	resetStore()
+
+	if _, err := Set("/k", "1", PERMANENT, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	if _, err := TestAndDelete("/k", "wrong", 0, 0); err == nil {
+		t.Fatalf("TestAndDelete with wrong prevValue succeeded, want EcodeTestFailed")
+	}
+
+	if _, err := TestAndDelete("/k", "1", 0, 0); err != nil {
+		t.Fatalf("TestAndDelete with matching prevValue: %v", err)
+	}
+
+	if got := Get("/k"); got.Exist {
+		t.Fatalf("Get(/k) after TestAndDelete still exists")
+	}
+
+	if _, err := Mkdir("/d", PERMANENT, 0); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if _, err := TestAndDelete("/d", "", 0, 0); err == nil {
+		t.Fatalf("TestAndDelete on a directory succeeded, want EcodeNotFile")
+	}
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCurrentIndexAutoAssigned verifies that passing index 0 auto-assigns
+// the next index and reports it back in Response.Index, and that
+// CurrentIndex advances across successive Sets.
+func TestCurrentIndexAutoAssigned(t *testing.T) {
+	resetStore()
+
+	msg, err := Set("/a", "1", PERMANENT, 0)
+	if err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	first := mustUnmarshal(t, msg).Index
+	if first == 0 {
+		t.Fatalf("Set auto-assigned Index = 0, want nonzero")
+	}
+
+	msg, err = Set("/b", "1", PERMANENT, 0)
+	if err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	second := mustUnmarshal(t, msg).Index
+	if second <= first {
+		t.Fatalf("Index did not advance: first=%d second=%d", first, second)
+	}
+
+	if s.CurrentIndex != second {
+		t.Fatalf("CurrentIndex = %d, want %d", s.CurrentIndex, second)
+	}
+}
+
+// TestConcurrentSetsSerialized hammers Set from many goroutines and
+// checks every assigned index came out distinct, i.e. worldLock actually
+// serializes mutations.
+func TestConcurrentSetsSerialized(t *testing.T) {
+	resetStore()
+
+	const n = 50
+	indexes := make([]uint64, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msg, err := Set("/concurrent", "v", PERMANENT, 0)
+			if err != nil {
+				t.Errorf("Set: %v", err)
+				return
+			}
+			var resp Response
+			if err := json.Unmarshal(msg, &resp); err != nil {
+				t.Errorf("unmarshal response: %v", err)
+				return
+			}
+			indexes[i] = resp.Index
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool, n)
+	for _, idx := range indexes {
+		if idx == 0 || seen[idx] {
+			t.Fatalf("duplicate or zero index %d among concurrent Sets: %v", idx, indexes)
+		}
+		seen[idx] = true
+	}
+}
+
+// TestExpireGoroutineRespectsCancel verifies Delete cancels a pending
+// expire goroutine instead of racing it: deleting a soon-to-expire key
+// and recreating it under the same name must not be clobbered by the
+// original expiry firing late.
+func TestExpireGoroutineRespectsCancel(t *testing.T) {
+	resetStore()
+
+	if _, err := Set("/a", "1", time.Now().Add(50*time.Millisecond), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := Delete("/a", 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := Set("/a", "2", PERMANENT, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	got := Get("/a")
+	if !got.Exist || got.NewValue != "2" {
+		t.Fatalf("Get(/a) = %+v, want the permanent value 2 to survive the original expiry", got)
+	}
+}
+
+func mustUnmarshal(t *testing.T, msg []byte) Response {
+	t.Helper()
+	var resp Response
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	return resp
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+// resetStore replaces the package-level store with a fresh one so tests
+// don't see state left behind by earlier tests.
+func resetStore() {
+	s = createStore()
+	s.messager = nil
+}
+
+// TestListRoot verifies that "/" behaves like any other directory for
+// Get/List even though it is never actually stored as a node: it always
+// exists, is always a directory, and lists whatever has been Set under it.
+func TestListRoot(t *testing.T) {
+	resetStore()
+
+	if _, err := Set("/a", "1", PERMANENT, 0); err != nil {
+		t.Fatalf("Set(/a): %v", err)
+	}
+
+	resp := List("/", false)
+	if !resp.Dir {
+		t.Fatalf("List(/) Dir = false, want true")
+	}
+	if len(resp.KVs) != 1 || resp.KVs[0].Key != "/a" {
+		t.Fatalf("List(/) KVs = %+v, want one entry for /a", resp.KVs)
+	}
+
+	got := Get("/")
+	if !got.Dir || len(got.KVs) != 1 {
+		t.Fatalf("Get(/) = %+v, want the same directory listing as List(/)", got)
+	}
+}
+
+// TestSetRootFails verifies the root directory can't be shadowed by a
+// plain value, since that would permanently hide the rest of the keyspace.
+func TestSetRootFails(t *testing.T) {
+	resetStore()
+
+	if _, err := Set("/", "oops", PERMANENT, 0); err == nil {
+		t.Fatalf("Set(/) succeeded, want EcodeNotFile error")
+	} else if se, ok := err.(*StoreError); !ok || se.ErrorCode != EcodeNotFile {
+		t.Fatalf("Set(/) err = %v, want EcodeNotFile", err)
+	}
+}
+
+// TestMkdirHierarchy verifies Set auto-creates missing parent
+// directories and that List finds nested entries.
+func TestMkdirHierarchy(t *testing.T) {
+	resetStore()
+
+	if _, err := Set("/a/b/c", "1", PERMANENT, 0); err != nil {
+		t.Fatalf("Set(/a/b/c): %v", err)
+	}
+
+	resp := Get("/a")
+	if !resp.Dir {
+		t.Fatalf("Get(/a).Dir = false, want true (auto-created parent)")
+	}
+
+	resp = List("/a", true)
+	if len(resp.KVs) != 2 {
+		t.Fatalf("List(/a, recursive) KVs = %+v, want /a/b and /a/b/c", resp.KVs)
+	}
+}
+
+// TestDeleteDirCancelsChildExpire verifies cascade-deleting a directory
+// cancels the expire goroutine for any child with a live TTL, the same
+// way a plain Delete does for a single key: recreating the key
+// permanently right after must not have it vanish when the original
+// timer fires.
+func TestDeleteDirCancelsChildExpire(t *testing.T) {
+	resetStore()
+
+	if _, err := Set("/a/b", "1", time.Now().Add(50*time.Millisecond), 0); err != nil {
+		t.Fatalf("Set(/a/b): %v", err)
+	}
+	if _, err := DeleteDir("/a", true, 0); err != nil {
+		t.Fatalf("DeleteDir(/a): %v", err)
+	}
+	if _, err := Set("/a/b", "2", PERMANENT, 0); err != nil {
+		t.Fatalf("Set(/a/b): %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	got := Get("/a/b")
+	if !got.Exist || got.NewValue != "2" {
+		t.Fatalf("Get(/a/b) = %+v, want the permanent value 2 to survive the original expiry", got)
+	}
+}
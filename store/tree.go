@@ -0,0 +1,157 @@
+package store
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/google/btree"
+)
+
+// treeDegree is the B-Tree's branching factor; the keyspace is rarely
+// large enough for this to matter, so we use the same default google/btree
+// itself suggests.
+const treeDegree = 32
+
+// treeItem is the B-Tree element backing Store's keyspace. Ordering is
+// by key, so the tree doubles as a sorted index: prefix scans (List,
+// DeleteDir) and Range/RangeReverse are just bounded tree walks instead
+// of a scan over every entry.
+type treeItem struct {
+	key  string
+	node Node
+}
+
+func (a *treeItem) Less(b btree.Item) bool {
+	return a.key < b.(*treeItem).key
+}
+
+// newTree builds an empty keyspace tree.
+func newTree() *btree.BTree {
+	return btree.New(treeDegree)
+}
+
+// getNode looks up key. The root "/" is never stored in the tree (see
+// ancestors in store.go), so it is special-cased here: it always exists,
+// is always a directory, and can't be shadowed by a Set. Callers must
+// hold worldLock (for reading).
+func (s *Store) getNode(key string) (Node, bool) {
+	if key == "/" {
+		return Node{Dir: true, ExpireTime: PERMANENT}, true
+	}
+
+	item := s.tree.Get(&treeItem{key: key})
+	if item == nil {
+		return Node{}, false
+	}
+
+	return item.(*treeItem).node, true
+}
+
+// putNode inserts or replaces the entry at key. Callers must hold worldLock.
+func (s *Store) putNode(key string, node Node) {
+	s.tree.ReplaceOrInsert(&treeItem{key: key, node: node})
+}
+
+// deleteNode removes key, if present. Callers must hold worldLock.
+func (s *Store) deleteNode(key string) {
+	s.tree.Delete(&treeItem{key: key})
+}
+
+// ascendPrefix calls fn, in ascending key order, for every entry whose
+// key has the given prefix, stopping early if fn returns false. Callers
+// must hold worldLock (for reading).
+func (s *Store) ascendPrefix(prefix string, fn func(key string, node Node) bool) {
+	s.tree.AscendGreaterOrEqual(&treeItem{key: prefix}, func(item btree.Item) bool {
+		it := item.(*treeItem)
+		if !strings.HasPrefix(it.key, prefix) {
+			return false
+		}
+
+		return fn(it.key, it.node)
+	})
+}
+
+// rangeAscend returns up to limit Responses (0 means unlimited) for keys
+// in [startKey, endKey), in ascending order. Callers must hold worldLock
+// (for reading).
+func (s *Store) rangeAscend(startKey, endKey string, limit int) []Response {
+	resps := make([]Response, 0)
+
+	s.tree.AscendRange(&treeItem{key: startKey}, &treeItem{key: endKey}, func(item btree.Item) bool {
+		it := item.(*treeItem)
+		resps = append(resps, nodeResponse(it.key, it.node))
+		return limit <= 0 || len(resps) < limit
+	})
+
+	return resps
+}
+
+// Range returns up to limit Responses (0 means unlimited) for keys in
+// [startKey, endKey), in ascending order.
+func Range(startKey, endKey string, limit int) []Response {
+	s.worldLock.RLock()
+	defer s.worldLock.RUnlock()
+
+	return s.rangeAscend(path.Clean(startKey), path.Clean(endKey), limit)
+}
+
+// RangeReverse is Range but returns keys in descending order.
+func RangeReverse(startKey, endKey string, limit int) []Response {
+	s.worldLock.RLock()
+	defer s.worldLock.RUnlock()
+
+	resps := s.rangeAscend(path.Clean(startKey), path.Clean(endKey), 0)
+
+	for i, j := 0, len(resps)-1; i < j; i, j = i+1, j-1 {
+		resps[i], resps[j] = resps[j], resps[i]
+	}
+
+	if limit > 0 && len(resps) > limit {
+		resps = resps[:limit]
+	}
+
+	return resps
+}
+
+// nodeResponse builds the plain GET Response describing node at key, the
+// shape Get/List/Range all return for a single entry.
+func nodeResponse(key string, node Node) Response {
+	return Response{GET, key, node.Value, node.Value, true, node.ExpireTime, 0, node.Dir, nil}
+}
+
+// storeWireFormat is the JSON shape Store has always persisted as; kept
+// stable across the map->B-Tree swap so old snapshots still load.
+type storeWireFormat struct {
+	Nodes        map[string]Node `json:"nodes"`
+	CurrentIndex uint64          `json:"currentIndex"`
+}
+
+func (s *Store) MarshalJSON() ([]byte, error) {
+	nodes := make(map[string]Node, s.tree.Len())
+
+	s.tree.Ascend(func(item btree.Item) bool {
+		it := item.(*treeItem)
+		nodes[it.key] = it.node
+		return true
+	})
+
+	return json.Marshal(storeWireFormat{Nodes: nodes, CurrentIndex: s.CurrentIndex})
+}
+
+func (s *Store) UnmarshalJSON(data []byte) error {
+	var wire storeWireFormat
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	tree := btree.New(treeDegree)
+	for k, n := range wire.Nodes {
+		tree.ReplaceOrInsert(&treeItem{key: k, node: n})
+	}
+
+	s.tree = tree
+	s.CurrentIndex = wire.CurrentIndex
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import "testing"
+
+// TestRangeOrdering verifies Range returns keys in ascending order
+// within [startKey, endKey) and RangeReverse returns the same set in
+// descending order, with limit applied after reversing.
+func TestRangeOrdering(t *testing.T) {
+	resetStore()
+
+	for _, k := range []string{"/c", "/a", "/e", "/b", "/d"} {
+		if _, err := Set(k, k, PERMANENT, 0); err != nil {
+			t.Fatalf("Set(%s): %v", k, err)
+		}
+	}
+
+	fwd := Range("/a", "/e", 0)
+	gotKeys := make([]string, len(fwd))
+	for i, r := range fwd {
+		gotKeys[i] = r.Key
+	}
+	want := []string{"/a", "/b", "/c", "/d"}
+	if !equalStrings(gotKeys, want) {
+		t.Fatalf("Range(/a,/e) = %v, want %v", gotKeys, want)
+	}
+
+	rev := RangeReverse("/a", "/e", 2)
+	gotKeys = make([]string, len(rev))
+	for i, r := range rev {
+		gotKeys[i] = r.Key
+	}
+	want = []string{"/d", "/c"}
+	if !equalStrings(gotKeys, want) {
+		t.Fatalf("RangeReverse(/a,/e,2) = %v, want %v", gotKeys, want)
+	}
+}
+
+// TestListIsSorted verifies List's children come back in ascending key
+// order, since Get always sorts (the B-Tree backing the keyspace makes
+// this the natural iteration order; there is no separate --sort knob).
+func TestListIsSorted(t *testing.T) {
+	resetStore()
+
+	for _, k := range []string{"/z", "/x", "/y"} {
+		if _, err := Set(k, k, PERMANENT, 0); err != nil {
+			t.Fatalf("Set(%s): %v", k, err)
+		}
+	}
+
+	resp := List("/", false)
+	gotKeys := make([]string, len(resp.KVs))
+	for i, r := range resp.KVs {
+		gotKeys[i] = r.Key
+	}
+	want := []string{"/x", "/y", "/z"}
+	if !equalStrings(gotKeys, want) {
+		t.Fatalf("List(/) = %v, want %v", gotKeys, want)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
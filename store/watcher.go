@@ -0,0 +1,190 @@
+package store
+
+import (
+	"strings"
+	"sync"
+)
+
+// defaultHistoryCapacity bounds how many past Responses a WatcherHub
+// retains for replay; a Watch whose sinceIndex predates the retained
+// window gets an EcodeEventIndexCleared StoreError instead of a silently
+// incomplete replay.
+const defaultHistoryCapacity = 1000
+
+// Watcher receives the Responses matching its prefix, and anything
+// nested under it when recursive is true, until canceled. An event that
+// arrives while C's buffer is full is dropped for this watcher, and the
+// watcher is not told that it missed it.
+type Watcher struct {
+	C chan Response
+
+	prefix    string
+	recursive bool
+}
+
+// CancelFunc stops a Watcher from receiving further events and removes
+// it from its hub.
+type CancelFunc func()
+
+// eventHistory is a fixed-size ring buffer of the most recently notified
+// Responses, letting a newly-registered Watcher replay what it missed.
+type eventHistory struct {
+	responses []Response
+	start     int
+	count     int
+	capacity  int
+}
+
+func newEventHistory(capacity int) *eventHistory {
+	return &eventHistory{responses: make([]Response, capacity), capacity: capacity}
+}
+
+func (h *eventHistory) add(resp Response) {
+	pos := (h.start + h.count) % h.capacity
+
+	if h.count < h.capacity {
+		h.responses[pos] = resp
+		h.count++
+		return
+	}
+
+	h.responses[h.start] = resp
+	h.start = (h.start + 1) % h.capacity
+}
+
+// since returns every retained response with Index >= index, oldest
+// first. ok is false when index is older than the oldest retained entry,
+// meaning some matching events can no longer be replayed.
+func (h *eventHistory) since(index uint64) (resps []Response, ok bool) {
+	if h.count == 0 {
+		return nil, true
+	}
+
+	if index < h.responses[h.start].Index {
+		return nil, false
+	}
+
+	for i := 0; i < h.count; i++ {
+		resp := h.responses[(h.start+i)%h.capacity]
+		if resp.Index >= index {
+			resps = append(resps, resp)
+		}
+	}
+
+	return resps, true
+}
+
+// WatcherHub fans store mutations out to the watchers registered for
+// them and retains a bounded history of past Responses for index-based
+// replay.
+type WatcherHub struct {
+	mutex    sync.Mutex
+	watchers map[string][]*Watcher
+	history  *eventHistory
+}
+
+func newWatcherHub(historyCapacity int) *WatcherHub {
+	return &WatcherHub{
+		watchers: make(map[string][]*Watcher),
+		history:  newEventHistory(historyCapacity),
+	}
+}
+
+// Watch registers a Watcher for prefix and returns its channel. See the
+// package-level store.Watch for the full contract.
+func (h *WatcherHub) Watch(prefix string, recursive bool, sinceIndex uint64) (<-chan Response, CancelFunc, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// buffered so a burst of replayed/live events doesn't stall notify
+	w := &Watcher{C: make(chan Response, 100), prefix: prefix, recursive: recursive}
+
+	if sinceIndex != 0 {
+		past, ok := h.history.since(sinceIndex)
+		if !ok {
+			return nil, nil, NewError(EcodeEventIndexCleared, prefix)
+		}
+
+		for _, resp := range past {
+			if !watcherMatches(w, resp.Key) {
+				continue
+			}
+
+			select {
+			case w.C <- resp:
+			default:
+				// more retained history matches than w.C can hold; drop
+				// the rest rather than blocking notify() (and everything
+				// behind s.worldLock) on this new watcher's buffer
+			}
+		}
+	}
+
+	h.watchers[prefix] = append(h.watchers[prefix], w)
+
+	cancel := func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		h.removeWatcher(w)
+	}
+
+	return w.C, cancel, nil
+}
+
+func (h *WatcherHub) removeWatcher(w *Watcher) {
+	ws := h.watchers[w.prefix]
+
+	for i, cand := range ws {
+		if cand == w {
+			h.watchers[w.prefix] = append(ws[:i], ws[i+1:]...)
+			break
+		}
+	}
+
+	if len(h.watchers[w.prefix]) == 0 {
+		delete(h.watchers, w.prefix)
+	}
+}
+
+// watcherMatches reports whether key is w's watched key, or (when w is
+// recursive) a descendant of it.
+func watcherMatches(w *Watcher, key string) bool {
+	if key == w.prefix {
+		return true
+	}
+
+	if !w.recursive {
+		return false
+	}
+
+	prefix := w.prefix
+	if prefix != "/" {
+		prefix += "/"
+	}
+
+	return strings.HasPrefix(key, prefix)
+}
+
+// notify records resp in history and fans it out to every matching
+// watcher. A watcher whose buffer is full is skipped rather than
+// blocking the writer.
+func (h *WatcherHub) notify(resp Response) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.history.add(resp)
+
+	for _, ws := range h.watchers {
+		for _, w := range ws {
+			if !watcherMatches(w, resp.Key) {
+				continue
+			}
+
+			select {
+			case w.C <- resp:
+			default:
+				// slow consumer; drop the event instead of blocking the writer
+			}
+		}
+	}
+}
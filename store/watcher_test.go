@@ -0,0 +1,144 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWatchLiveEvent verifies a Watch subscriber sees a mutation made
+// after it subscribes, under its watched prefix but not outside it.
+func TestWatchLiveEvent(t *testing.T) {
+	resetStore()
+
+	ch, cancel, err := Watch("/a", false, 0)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	defer cancel()
+
+	if _, err := Set("/b", "1", PERMANENT, 0); err != nil {
+		t.Fatalf("Set(/b): %v", err)
+	}
+	if _, err := Set("/a", "1", PERMANENT, 0); err != nil {
+		t.Fatalf("Set(/a): %v", err)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Key != "/a" {
+			t.Fatalf("watcher received %q, want /a", resp.Key)
+		}
+	default:
+		t.Fatalf("watcher received nothing, want the /a mutation")
+	}
+
+	select {
+	case resp := <-ch:
+		t.Fatalf("watcher received unexpected extra event %+v", resp)
+	default:
+	}
+}
+
+// TestWatchRecursiveMatchesDescendants verifies a recursive watcher on a
+// directory also sees mutations to its descendants.
+func TestWatchRecursiveMatchesDescendants(t *testing.T) {
+	resetStore()
+
+	ch, cancel, err := Watch("/a", true, 0)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	defer cancel()
+
+	if _, err := Set("/a/b/c", "1", PERMANENT, 0); err != nil {
+		t.Fatalf("Set(/a/b/c): %v", err)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Key != "/a/b/c" {
+			t.Fatalf("watcher received %q, want /a/b/c", resp.Key)
+		}
+	default:
+		t.Fatalf("recursive watcher received nothing, want the descendant mutation")
+	}
+}
+
+// TestWatchReplaysHistory verifies a Watch with a sinceIndex inside the
+// retained history replays matching past events before live ones.
+func TestWatchReplaysHistory(t *testing.T) {
+	resetStore()
+
+	if _, err := Set("/a", "1", PERMANENT, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := Set("/a", "2", PERMANENT, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	ch, cancel, err := Watch("/a", false, 1)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	defer cancel()
+
+	first := <-ch
+	if first.NewValue != "1" {
+		t.Fatalf("replayed first event NewValue = %q, want %q", first.NewValue, "1")
+	}
+	second := <-ch
+	if second.NewValue != "2" {
+		t.Fatalf("replayed second event NewValue = %q, want %q", second.NewValue, "2")
+	}
+}
+
+// TestWatchReplayOverflowDoesNotBlock verifies that replaying more
+// history than w.C's buffer can hold drops the excess instead of
+// blocking Watch (and, transitively, notify()/worldLock) forever.
+func TestWatchReplayOverflowDoesNotBlock(t *testing.T) {
+	resetStore()
+
+	const n = 200 // more than the Watcher channel's 100-slot buffer
+	for i := 0; i < n; i++ {
+		if _, err := Set("/a", "x", PERMANENT, 0); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_, cancel, err := Watch("/a", false, 1)
+		if err != nil {
+			t.Errorf("Watch: %v", err)
+			close(done)
+			return
+		}
+		cancel()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Watch with a history replay larger than the channel buffer hung")
+	}
+}
+
+// TestWatchIndexCleared verifies Watch rejects a sinceIndex older than
+// the oldest retained history entry.
+func TestWatchIndexCleared(t *testing.T) {
+	resetStore()
+	s.watcher = newWatcherHub(2)
+
+	for i := 0; i < 5; i++ {
+		if _, err := Set("/a", "x", PERMANENT, 0); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+
+	if _, _, err := Watch("/a", false, 1); err == nil {
+		t.Fatalf("Watch with a cleared sinceIndex succeeded, want EcodeEventIndexCleared")
+	} else if se, ok := err.(*StoreError); !ok || se.ErrorCode != EcodeEventIndexCleared {
+		t.Fatalf("Watch err = %v, want EcodeEventIndexCleared", err)
+	}
+}